@@ -0,0 +1,31 @@
+package ipset
+
+import "context"
+
+// Backend is the set of operations an ipset implementation must support. It
+// mirrors the public surface of IPSet so that IPSet can dispatch every call
+// to whichever implementation it was constructed with. Every method takes a
+// context.Context so callers can bound or cancel the underlying operation;
+// the exec backend propagates it to the child process via
+// exec.CommandContext.
+//
+// The exec backend (used by New) shells out to the ipset userspace binary.
+// NewNetlinkBackend speaks the NFNL_SUBSYS_IPSET protocol directly against
+// the kernel over a NETLINK_NETFILTER socket, avoiding the fork/exec
+// overhead of the CLI path.
+type Backend interface {
+	Create(ctx context.Context, name, hashType string, p *Params, opts ...string) error
+	Add(ctx context.Context, name, entry string, opts ...string) error
+	Del(ctx context.Context, name, entry string, opts ...string) error
+	Test(ctx context.Context, name, entry string) (bool, error)
+	Destroy(ctx context.Context, name string, opts ...string) error
+	DestroyAll(ctx context.Context) error
+	List(ctx context.Context, name string) ([]string, error)
+	ListSorted(ctx context.Context, name string) ([]string, error)
+	ListSets(ctx context.Context) ([]string, error)
+	Flush(ctx context.Context, name string, opts ...string) error
+	FlushAll(ctx context.Context) error
+	Swap(ctx context.Context, from, to string) error
+	Save(ctx context.Context) ([]byte, error)
+	Restore(ctx context.Context, data []byte) error
+}
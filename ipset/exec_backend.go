@@ -0,0 +1,201 @@
+package ipset
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const minIPSetVersion = "6.0.0"
+
+// execBackend implements Backend by shelling out to the ipset userspace
+// binary for every operation. It is the backend New() uses by default.
+type execBackend struct {
+	path string
+}
+
+// newExecBackend locates the ipset binary and verifies it meets
+// minIPSetVersion.
+func newExecBackend() (*execBackend, error) {
+	path, err := exec.LookPath("ipset")
+	if err != nil {
+		return nil, err
+	}
+	eb := &execBackend{path: path}
+	supported, err := checkVersion(context.Background(), path)
+	if err != nil {
+		return nil, fmt.Errorf("error validating ipset version: %s", err)
+	}
+	if !supported {
+		return nil, fmt.Errorf("ipset version is not supported")
+	}
+	return eb, nil
+}
+
+// Create creates new ipset
+func (eb *execBackend) Create(ctx context.Context, name string, hashType string, p *Params, opts ...string) error {
+	cmd, err := createArgs(name, hashType, p, opts...)
+	if err != nil {
+		return err
+	}
+	_, stderr, err := run(ctx, eb.path, nil, cmd)
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, stderr)
+	}
+	return nil
+}
+
+// createArgs builds the "create" command line shared by the exec backend
+// and Batch, filling in the same defaults the CLI path has always used.
+func createArgs(name, hashType string, p *Params, opts ...string) ([]string, error) {
+	// set default ipset values
+	if p.HashSize == 0 {
+		p.HashSize = 1024
+	}
+	if p.MaxElem == 0 {
+		p.MaxElem = 65536
+	}
+	if p.HashFamily == "" {
+		p.HashFamily = "inet"
+	}
+
+	// check hash type is in form 'hash:<TYPE>'
+	if !strings.HasPrefix(hashType, "hash:") {
+		return nil, fmt.Errorf("not a hash type: %s", hashType)
+	}
+
+	return append([]string{"create", name, hashType, "family", p.HashFamily, "hashsize", strconv.Itoa(p.HashSize),
+		"maxelem", strconv.Itoa(p.MaxElem), "timeout", strconv.Itoa(p.Timeout)}, opts...), nil
+}
+
+// Add adds an entry to the set
+// opts are additional parameters, for example "timeout 10"
+func (eb *execBackend) Add(ctx context.Context, name, entry string, opts ...string) error {
+	cmd := append([]string{"add", name, entry}, opts...)
+	_, stderr, err := run(ctx, eb.path, nil, cmd)
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, stderr)
+	}
+	return nil
+}
+
+// Del deletes entry from the set
+func (eb *execBackend) Del(ctx context.Context, name, entry string, opts ...string) error {
+	cmd := append([]string{"del", name, entry}, opts...)
+	_, stderr, err := run(ctx, eb.path, nil, cmd)
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, stderr)
+	}
+	return nil
+}
+
+// Test checks if set contains an entry
+func (eb *execBackend) Test(ctx context.Context, name, entry string) (bool, error) {
+	out, stderr, err := run(ctx, eb.path, nil, []string{"test", name, entry})
+	if err != nil {
+		return false, fmt.Errorf("%v: %s", err, stderr)
+	}
+	// The CLI reports "is in set" as a warning on stderr, so check both streams.
+	re := regexp.MustCompile(`is in set`)
+	if re.Match(out) || re.Match(stderr) {
+		return true, nil
+	}
+	return false, fmt.Errorf("%s%s", out, stderr)
+}
+
+// Destroy destroys the set.
+func (eb *execBackend) Destroy(ctx context.Context, name string, opts ...string) error {
+	cmd := append([]string{"destroy", name}, opts...)
+	_, stderr, err := run(ctx, eb.path, nil, cmd)
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, stderr)
+	}
+	return nil
+}
+
+// DestroyAll destroys all sets.
+func (eb *execBackend) DestroyAll(ctx context.Context) error {
+	_, stderr, err := run(ctx, eb.path, nil, []string{"destroy"})
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, stderr)
+	}
+	return nil
+}
+
+// List returns members of a set, via the same `ipset list -o xml` parsing
+// ListXML uses, so there is one parser for the set's member data instead of
+// a second one scraping the human-readable text format.
+func (eb *execBackend) List(ctx context.Context, name string) ([]string, error) {
+	info, err := eb.listXML(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return flattenMembers(info.Members), nil
+}
+
+// ListSorted same as List, but returns sorted slice
+func (eb *execBackend) ListSorted(ctx context.Context, name string) ([]string, error) {
+	info, err := eb.listXML(ctx, name, "-sorted")
+	if err != nil {
+		return nil, err
+	}
+	return flattenMembers(info.Members), nil
+}
+
+// ListSets returns all sets
+func (eb *execBackend) ListSets(ctx context.Context) ([]string, error) {
+	out, stderr, err := run(ctx, eb.path, nil, []string{"list", "-n"})
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, stderr)
+	}
+	return strings.Split(string(out), "\n"), nil
+}
+
+// Flush removes all entries from the set
+func (eb *execBackend) Flush(ctx context.Context, name string, opts ...string) error {
+	cmd := append([]string{"flush", name}, opts...)
+	_, stderr, err := run(ctx, eb.path, nil, cmd)
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, stderr)
+	}
+	return nil
+}
+
+// FlushAll removes all entries from all sets
+func (eb *execBackend) FlushAll(ctx context.Context) error {
+	_, stderr, err := run(ctx, eb.path, nil, []string{"flush"})
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, stderr)
+	}
+	return nil
+}
+
+// Swap swaps the content of two existing sets
+func (eb *execBackend) Swap(ctx context.Context, from, to string) error {
+	out, _, err := run(ctx, eb.path, nil, []string{"swap", from, to})
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, out)
+	}
+	return nil
+}
+
+// Save returns ipset save output as []byte
+func (eb *execBackend) Save(ctx context.Context) ([]byte, error) {
+	out, stderr, err := run(ctx, eb.path, nil, []string{"save"})
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, stderr)
+	}
+	return out, nil
+}
+
+// Restore invokes ipset restore with stdin data
+func (eb *execBackend) Restore(ctx context.Context, data []byte) error {
+	_, stderr, err := run(ctx, eb.path, data, []string{"restore"})
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, stderr)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package ipset
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os/exec"
 	"regexp"
@@ -9,8 +10,11 @@ import (
 	"github.com/coreos/go-semver/semver"
 )
 
-func (ips *IPSet) run(in []byte, cmd []string) ([]byte, []byte, error) {
-	c := exec.Command(ips.path, cmd...)
+// run executes the ipset binary at path with the given args, optionally
+// piping in to its stdin, and returns stdout/stderr separately. Cancelling
+// ctx terminates the child process, same as exec.CommandContext.
+func run(ctx context.Context, path string, in []byte, cmd []string) ([]byte, []byte, error) {
+	c := exec.CommandContext(ctx, path, cmd...)
 	if in != nil {
 		_stdin, err := c.StdinPipe()
 		if err != nil {
@@ -30,12 +34,12 @@ func (ips *IPSet) run(in []byte, cmd []string) ([]byte, []byte, error) {
 	return stdout.Bytes(), stderr.Bytes(), err
 }
 
-func (ips *IPSet) checkVersion() (bool, error) {
+func checkVersion(ctx context.Context, path string) (bool, error) {
 	minVersion, err := semver.NewVersion(minIPSetVersion)
 	if err != nil {
 		return false, fmt.Errorf("unable to parse minIPSetVersion: %s", err)
 	}
-	stdout, stderr, err := ips.run(nil /* in */, []string{"--version"} /* cmd */)
+	stdout, stderr, err := run(ctx, path, nil /* in */, []string{"--version"} /* cmd */)
 	if err != nil {
 		return false, fmt.Errorf("unable to get ipset version: %v: %s", err, stderr)
 	}
@@ -17,15 +17,7 @@ limitations under the License.
 // Package ipset is a library providing a wrapper to the IPtables ipset userspace utility
 package ipset
 
-import (
-	"fmt"
-	"os/exec"
-	"regexp"
-	"strconv"
-	"strings"
-)
-
-const minIPSetVersion = "6.0.0"
+import "context"
 
 // Params defines optional parameters for creating a new set.
 type Params struct {
@@ -35,182 +27,172 @@ type Params struct {
 	Timeout    int
 }
 
-// Cmd is an interface to ipset command
+// IPSet is a handle to an ipset Backend. By default it dispatches to the
+// ipset userspace binary; see NewWithBackend to use a different
+// implementation such as NewNetlinkBackend.
 type IPSet struct {
-	path string
+	backend Backend
 }
 
 // New returns new ipset command instance
 func New() (*IPSet, error) {
-	path, err := exec.LookPath("ipset")
+	eb, err := newExecBackend()
 	if err != nil {
 		return nil, err
 	}
-	cmd := &IPSet{path: path}
-	supported, err := cmd.checkVersion()
-	if err != nil {
-		return nil, fmt.Errorf("error validating ipset version: %s", err)
-	}
-	if !supported {
-		return nil, fmt.Errorf("ipset version is not supported")
-	}
-	return cmd, nil
+	return &IPSet{backend: eb}, nil
+}
+
+// NewWithBackend returns a new IPSet handle dispatching to the given
+// Backend, e.g. one created with NewNetlinkBackend, instead of shelling out
+// to the ipset binary.
+func NewWithBackend(b Backend) *IPSet {
+	return &IPSet{backend: b}
 }
 
 // Create creates new ipset
 func (ips *IPSet) Create(name string, hashType string, p *Params, opts ...string) error {
-	// set default ipset values
-	if p.HashSize == 0 {
-		p.HashSize = 1024
-	}
-	if p.MaxElem == 0 {
-		p.MaxElem = 65536
-	}
-	if p.HashFamily == "" {
-		p.HashFamily = "inet"
-	}
-
-	// check hash type is in form 'hash:<TYPE>'
-	if !strings.HasPrefix(hashType, "hash:") {
-		return fmt.Errorf("not a hash type: %s", hashType)
-	}
-
-	cmd := append([]string{"create", name, hashType, "family", p.HashFamily, "hashsize", strconv.Itoa(p.HashSize),
-		"maxelem", strconv.Itoa(p.MaxElem), "timeout", strconv.Itoa(p.Timeout)}, opts...)
-	out, err := exec.Command(ips.path, cmd...).CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("%v: %s", err, out)
-	}
+	return ips.CreateContext(context.Background(), name, hashType, p, opts...)
+}
 
-	return nil
+// CreateContext is Create with a caller-supplied context.
+func (ips *IPSet) CreateContext(ctx context.Context, name string, hashType string, p *Params, opts ...string) error {
+	return ips.backend.Create(ctx, name, hashType, p, opts...)
 }
 
 // Add adds an entry to the set
 // opts are additional parameters, for example "timeout 10"
 func (ips *IPSet) Add(name, entry string, opts ...string) error {
-	cmd := append([]string{"add", name, entry}, opts...)
-	out, err := exec.Command(ips.path, cmd...).CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("%v: %s", err, out)
-	}
-	return nil
+	return ips.AddContext(context.Background(), name, entry, opts...)
+}
+
+// AddContext is Add with a caller-supplied context.
+func (ips *IPSet) AddContext(ctx context.Context, name, entry string, opts ...string) error {
+	return ips.backend.Add(ctx, name, entry, opts...)
 }
 
 // Del deletes entry from the set
 func (ips *IPSet) Del(name, entry string, opts ...string) error {
-	cmd := append([]string{"del", name, entry}, opts...)
-	out, err := exec.Command(ips.path, cmd...).CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("%v: %s", err, out)
-	}
-	return nil
+	return ips.DelContext(context.Background(), name, entry, opts...)
+}
+
+// DelContext is Del with a caller-supplied context.
+func (ips *IPSet) DelContext(ctx context.Context, name, entry string, opts ...string) error {
+	return ips.backend.Del(ctx, name, entry, opts...)
 }
 
 // Test checks if set contains an entry
 func (ips *IPSet) Test(name, entry string) (bool, error) {
-	out, err := exec.Command(ips.path, "test", name, entry).CombinedOutput()
-	if err != nil {
-		return false, fmt.Errorf("%v: %s", err, out)
-	}
-	if regexp.MustCompile(`is in set`).Match(out) {
-		return true, nil
-	}
-	return false, fmt.Errorf("%s", out)
+	return ips.TestContext(context.Background(), name, entry)
+}
+
+// TestContext is Test with a caller-supplied context.
+func (ips *IPSet) TestContext(ctx context.Context, name, entry string) (bool, error) {
+	return ips.backend.Test(ctx, name, entry)
 }
 
 // Destroy destroys the set.
 func (ips *IPSet) Destroy(name string, opts ...string) error {
-	cmd := append([]string{"destroy", name}, opts...)
-	out, err := exec.Command(ips.path, cmd...).CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("%v: %s", err, out)
-	}
-	return nil
+	return ips.DestroyContext(context.Background(), name, opts...)
+}
+
+// DestroyContext is Destroy with a caller-supplied context.
+func (ips *IPSet) DestroyContext(ctx context.Context, name string, opts ...string) error {
+	return ips.backend.Destroy(ctx, name, opts...)
 }
 
 // DestroyAll destroys all sets.
 func (ips *IPSet) DestroyAll() error {
-	out, err := exec.Command(ips.path, "destroy").CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("%v: %s", err, out)
-	}
-	return nil
+	return ips.DestroyAllContext(context.Background())
+}
+
+// DestroyAllContext is DestroyAll with a caller-supplied context.
+func (ips *IPSet) DestroyAllContext(ctx context.Context) error {
+	return ips.backend.DestroyAll(ctx)
 }
 
-// List returns members of a set
+// List returns members of a set. When using the exec backend this is
+// implemented on top of ListXML; see that method for access to per-member
+// timeouts, counters and comments.
 func (ips *IPSet) List(name string) ([]string, error) {
-	out, err := exec.Command(ips.path, "list", name).CombinedOutput()
-	if err != nil {
-		return []string{}, fmt.Errorf("%v: %s", err, out)
-	}
-	listFull := regexp.MustCompile(`(?m)^(.*\n)*Members:\n`).ReplaceAll(out[:], nil)
-	listAddrs := regexp.MustCompile(`([^\s]+).*`).FindAllSubmatch(listFull, -1)
-	var ret []string
-	for _, b := range listAddrs {
-		ret = append(ret, string(b[1]))
-	}
-	return ret, nil
+	return ips.ListContext(context.Background(), name)
+}
+
+// ListContext is List with a caller-supplied context.
+func (ips *IPSet) ListContext(ctx context.Context, name string) ([]string, error) {
+	return ips.backend.List(ctx, name)
 }
 
 // ListSorted same as List, but returns sorted slice
 func (ips *IPSet) ListSorted(name string) ([]string, error) {
-	out, err := exec.Command(ips.path, "list", name, "-sorted").CombinedOutput()
-	if err != nil {
-		return []string{}, fmt.Errorf("%v: %s", err, out)
-	}
-	listFull := regexp.MustCompile(`(?m)^(.*\n)*Members:\n`).ReplaceAll(out[:], nil)
-	listAddrs := regexp.MustCompile(`([^\s]+).*`).FindAllSubmatch(listFull, -1)
-	var ret []string
-	for _, b := range listAddrs {
-		ret = append(ret, string(b[1]))
+	return ips.ListSortedContext(context.Background(), name)
+}
+
+// ListSortedContext is ListSorted with a caller-supplied context.
+func (ips *IPSet) ListSortedContext(ctx context.Context, name string) ([]string, error) {
+	return ips.backend.ListSorted(ctx, name)
+}
+
+func flattenMembers(members []Member) []string {
+	ret := make([]string, 0, len(members))
+	for _, m := range members {
+		ret = append(ret, m.Elem)
 	}
-	return ret, nil
+	return ret
 }
 
 // ListSets returns all sets
 func (ips *IPSet) ListSets() ([]string, error) {
-	out, err := exec.Command(ips.path, "list", "-n").CombinedOutput()
-	if err != nil {
-		return nil, fmt.Errorf("%v: %s", err, out)
-	}
-	return strings.Split(string(out), "\n"), nil
+	return ips.ListSetsContext(context.Background())
+}
+
+// ListSetsContext is ListSets with a caller-supplied context.
+func (ips *IPSet) ListSetsContext(ctx context.Context) ([]string, error) {
+	return ips.backend.ListSets(ctx)
 }
 
 // Flush removes all entries from the set
 func (ips *IPSet) Flush(name string, opts ...string) error {
-	cmd := append([]string{"flush", name}, opts...)
-	out, err := exec.Command(ips.path, cmd...).CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("%v: %s", err, out)
-	}
-	return nil
+	return ips.FlushContext(context.Background(), name, opts...)
+}
+
+// FlushContext is Flush with a caller-supplied context.
+func (ips *IPSet) FlushContext(ctx context.Context, name string, opts ...string) error {
+	return ips.backend.Flush(ctx, name, opts...)
 }
 
 // FlushAll removes all entries from all sets
 func (ips *IPSet) FlushAll() error {
-	out, err := exec.Command(ips.path, "flush").CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("%v: %s", err, out)
-	}
-	return nil
+	return ips.FlushAllContext(context.Background())
+}
+
+// FlushAllContext is FlushAll with a caller-supplied context.
+func (ips *IPSet) FlushAllContext(ctx context.Context) error {
+	return ips.backend.FlushAll(ctx)
 }
 
 // Swap swaps the content of two existing sets
 func (ips *IPSet) Swap(from, to string) error {
-	out, err := exec.Command(ips.path, "swap", from, to).Output()
-	if err != nil {
-		return fmt.Errorf("%v: %s", err, out)
-	}
-	return nil
+	return ips.SwapContext(context.Background(), from, to)
+}
+
+// SwapContext is Swap with a caller-supplied context.
+func (ips *IPSet) SwapContext(ctx context.Context, from, to string) error {
+	return ips.backend.Swap(ctx, from, to)
 }
 
 // Replace overwrites the set with new entries
 func (ips *IPSet) Replace(name string, entries []string) error {
-	if err := ips.Flush(name); err != nil {
+	return ips.ReplaceContext(context.Background(), name, entries)
+}
+
+// ReplaceContext is Replace with a caller-supplied context.
+func (ips *IPSet) ReplaceContext(ctx context.Context, name string, entries []string) error {
+	if err := ips.FlushContext(ctx, name); err != nil {
 		return err
 	}
 	for _, entry := range entries {
-		if err := ips.Add(name, entry); err != nil {
+		if err := ips.AddContext(ctx, name, entry); err != nil {
 			return err
 		}
 	}
@@ -219,30 +201,20 @@ func (ips *IPSet) Replace(name string, entries []string) error {
 
 // Save returns ipset save output as []byte
 func (ips *IPSet) Save() ([]byte, error) {
-	out, err := exec.Command(ips.path, []string{"save"}...).CombinedOutput()
-	if err != nil {
-		return nil, fmt.Errorf("%v: %s", err, out)
-	}
-	return out, nil
+	return ips.SaveContext(context.Background())
+}
+
+// SaveContext is Save with a caller-supplied context.
+func (ips *IPSet) SaveContext(ctx context.Context) ([]byte, error) {
+	return ips.backend.Save(ctx)
 }
 
 // Restore invokes ipset restore with stdin data
 func (ips *IPSet) Restore(data []byte) error {
-	cmd := exec.Command(ips.path, []string{"restore"}...)
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return fmt.Errorf("error creating stdin pipe: %s", err)
-	}
-
-	go func() {
-		defer stdin.Close()
-		stdin.Write(data)
-	}()
-
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("%v: %s", err, out)
-	}
+	return ips.RestoreContext(context.Background(), data)
+}
 
-	return nil
+// RestoreContext is Restore with a caller-supplied context.
+func (ips *IPSet) RestoreContext(ctx context.Context, data []byte) error {
+	return ips.backend.Restore(ctx, data)
 }
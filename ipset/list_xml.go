@@ -0,0 +1,210 @@
+package ipset
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SetInfo is the typed result of ListXML: the set's header plus every
+// member, including the per-entry metadata `ipset list` normally discards
+// when only the member string is kept.
+type SetInfo struct {
+	Name       string
+	Type       string
+	Revision   int
+	Family     string
+	HashSize   int
+	MaxElem    int
+	Timeout    int
+	References int
+	MemSize    int
+	Members    []Member
+}
+
+// Member is a single entry of a SetInfo, as reported by `ipset list -o xml`.
+// Fields that only apply to some set types (timeout sets, comment sets,
+// counters, SKB sets) are nil/zero when the set doesn't carry them.
+type Member struct {
+	Elem     string
+	Timeout  *time.Duration
+	Packets  *uint64
+	Bytes    *uint64
+	Comment  string
+	SKBMark  *uint32
+	SKBPrio  *uint32
+	SKBQueue *uint32
+}
+
+type xmlIPSets struct {
+	IPSet xmlIPSet `xml:"ipset"`
+}
+
+type xmlIPSet struct {
+	Name     string      `xml:"name,attr"`
+	Type     string      `xml:"type"`
+	Revision string      `xml:"revision"`
+	Header   xmlHeader   `xml:"header"`
+	Members  []xmlMember `xml:"members>member"`
+}
+
+type xmlHeader struct {
+	Family     string `xml:"family"`
+	HashSize   string `xml:"hashsize"`
+	MaxElem    string `xml:"maxelem"`
+	Timeout    string `xml:"timeout"`
+	MemSize    string `xml:"memsize"`
+	References string `xml:"references"`
+}
+
+type xmlMember struct {
+	Elem     string `xml:"elem"`
+	Timeout  string `xml:"timeout"`
+	Packets  string `xml:"packets"`
+	Bytes    string `xml:"bytes"`
+	Comment  string `xml:"comment"`
+	SKBMark  string `xml:"skbmark"`
+	SKBPrio  string `xml:"skbprio"`
+	SKBQueue string `xml:"skbqueue"`
+}
+
+// ListXML returns the full header and member metadata of a set by parsing
+// `ipset list -o xml`, instead of discarding everything but the member
+// string the way List does. Only the exec backend supports it.
+func (ips *IPSet) ListXML(name string) (*SetInfo, error) {
+	return ips.ListXMLContext(context.Background(), name)
+}
+
+// ListXMLContext is ListXML with a caller-supplied context.
+func (ips *IPSet) ListXMLContext(ctx context.Context, name string) (*SetInfo, error) {
+	eb, ok := ips.backend.(*execBackend)
+	if !ok {
+		return nil, fmt.Errorf("ipset: ListXML requires the exec backend (ipset binary)")
+	}
+	return eb.listXML(ctx, name)
+}
+
+// listXML is the shared implementation behind ListXML and execBackend's
+// List/ListSorted. ListXML returns the full per-member data `ipset list
+// -o xml` reports; List/ListSorted keep only each member's Elem.
+func (eb *execBackend) listXML(ctx context.Context, name string, opts ...string) (*SetInfo, error) {
+	args := append([]string{"list", name, "-o", "xml"}, opts...)
+	out, stderr, err := run(ctx, eb.path, nil, args)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, stderr)
+	}
+
+	var doc xmlIPSets
+	if err := xml.Unmarshal(out, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing ipset xml output: %s", err)
+	}
+
+	return doc.IPSet.toSetInfo()
+}
+
+func (x xmlIPSet) toSetInfo() (*SetInfo, error) {
+	info := &SetInfo{
+		Name:   x.Name,
+		Type:   x.Type,
+		Family: x.Header.Family,
+	}
+
+	var err error
+	if info.Revision, err = atoiOrZero(x.Revision); err != nil {
+		return nil, fmt.Errorf("invalid revision %q: %s", x.Revision, err)
+	}
+	if info.HashSize, err = atoiOrZero(x.Header.HashSize); err != nil {
+		return nil, fmt.Errorf("invalid hashsize %q: %s", x.Header.HashSize, err)
+	}
+	if info.MaxElem, err = atoiOrZero(x.Header.MaxElem); err != nil {
+		return nil, fmt.Errorf("invalid maxelem %q: %s", x.Header.MaxElem, err)
+	}
+	if info.Timeout, err = atoiOrZero(x.Header.Timeout); err != nil {
+		return nil, fmt.Errorf("invalid timeout %q: %s", x.Header.Timeout, err)
+	}
+	if info.References, err = atoiOrZero(x.Header.References); err != nil {
+		return nil, fmt.Errorf("invalid references %q: %s", x.Header.References, err)
+	}
+	if info.MemSize, err = atoiOrZero(x.Header.MemSize); err != nil {
+		return nil, fmt.Errorf("invalid memsize %q: %s", x.Header.MemSize, err)
+	}
+
+	info.Members = make([]Member, 0, len(x.Members))
+	for _, xm := range x.Members {
+		m, err := xm.toMember()
+		if err != nil {
+			return nil, fmt.Errorf("member %q: %s", xm.Elem, err)
+		}
+		info.Members = append(info.Members, m)
+	}
+	return info, nil
+}
+
+func (xm xmlMember) toMember() (Member, error) {
+	m := Member{Elem: xm.Elem, Comment: xm.Comment}
+
+	if xm.Timeout != "" {
+		secs, err := strconv.Atoi(xm.Timeout)
+		if err != nil {
+			return m, fmt.Errorf("invalid timeout %q: %s", xm.Timeout, err)
+		}
+		d := time.Duration(secs) * time.Second
+		m.Timeout = &d
+	}
+	if xm.Packets != "" {
+		v, err := strconv.ParseUint(xm.Packets, 10, 64)
+		if err != nil {
+			return m, fmt.Errorf("invalid packets %q: %s", xm.Packets, err)
+		}
+		m.Packets = &v
+	}
+	if xm.Bytes != "" {
+		v, err := strconv.ParseUint(xm.Bytes, 10, 64)
+		if err != nil {
+			return m, fmt.Errorf("invalid bytes %q: %s", xm.Bytes, err)
+		}
+		m.Bytes = &v
+	}
+	if xm.SKBMark != "" {
+		mark, _, _ := strings.Cut(xm.SKBMark, "/")
+		v, err := strconv.ParseUint(strings.TrimPrefix(mark, "0x"), 16, 32)
+		if err != nil {
+			return m, fmt.Errorf("invalid skbmark %q: %s", xm.SKBMark, err)
+		}
+		v32 := uint32(v)
+		m.SKBMark = &v32
+	}
+	if xm.SKBPrio != "" {
+		major, minor, _ := strings.Cut(xm.SKBPrio, ":")
+		maj, err := strconv.ParseUint(major, 16, 16)
+		if err != nil {
+			return m, fmt.Errorf("invalid skbprio %q: %s", xm.SKBPrio, err)
+		}
+		min, err := strconv.ParseUint(minor, 16, 16)
+		if err != nil {
+			return m, fmt.Errorf("invalid skbprio %q: %s", xm.SKBPrio, err)
+		}
+		v32 := uint32(maj)<<16 | uint32(min)
+		m.SKBPrio = &v32
+	}
+	if xm.SKBQueue != "" {
+		v, err := strconv.ParseUint(xm.SKBQueue, 10, 32)
+		if err != nil {
+			return m, fmt.Errorf("invalid skbqueue %q: %s", xm.SKBQueue, err)
+		}
+		v32 := uint32(v)
+		m.SKBQueue = &v32
+	}
+
+	return m, nil
+}
+
+func atoiOrZero(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(s)
+}
@@ -0,0 +1,134 @@
+package ipset
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+func TestXMLIPSetToSetInfo(t *testing.T) {
+	const doc = `<?xml version="1.0"?>
+<ipsets>
+  <ipset name="myset">
+    <type>hash:ip</type>
+    <revision>4</revision>
+    <header>
+      <family>inet</family>
+      <hashsize>1024</hashsize>
+      <maxelem>65536</maxelem>
+      <timeout>30</timeout>
+      <memsize>1234</memsize>
+      <references>2</references>
+    </header>
+    <members>
+      <member>
+        <elem>10.0.0.1</elem>
+        <timeout>25</timeout>
+        <packets>7</packets>
+        <bytes>420</bytes>
+        <comment>web server</comment>
+      </member>
+      <member>
+        <elem>10.0.0.2</elem>
+      </member>
+    </members>
+  </ipset>
+</ipsets>`
+
+	var doc2 xmlIPSets
+	if err := xml.Unmarshal([]byte(doc), &doc2); err != nil {
+		t.Fatalf("xml.Unmarshal: %s", err)
+	}
+
+	info, err := doc2.IPSet.toSetInfo()
+	if err != nil {
+		t.Fatalf("toSetInfo: %s", err)
+	}
+
+	if info.Name != "myset" || info.Type != "hash:ip" || info.Revision != 4 {
+		t.Fatalf("unexpected header fields: %+v", info)
+	}
+	if info.HashSize != 1024 || info.MaxElem != 65536 || info.Timeout != 30 {
+		t.Fatalf("unexpected header fields: %+v", info)
+	}
+	if info.MemSize != 1234 || info.References != 2 {
+		t.Fatalf("unexpected header fields: %+v", info)
+	}
+	if len(info.Members) != 2 {
+		t.Fatalf("expected 2 members, got %d", len(info.Members))
+	}
+
+	m0 := info.Members[0]
+	if m0.Elem != "10.0.0.1" {
+		t.Errorf("member[0].Elem = %q, want 10.0.0.1", m0.Elem)
+	}
+	if m0.Timeout == nil || *m0.Timeout != 25*time.Second {
+		t.Errorf("member[0].Timeout = %v, want 25s", m0.Timeout)
+	}
+	if m0.Packets == nil || *m0.Packets != 7 {
+		t.Errorf("member[0].Packets = %v, want 7", m0.Packets)
+	}
+	if m0.Bytes == nil || *m0.Bytes != 420 {
+		t.Errorf("member[0].Bytes = %v, want 420", m0.Bytes)
+	}
+	if m0.Comment != "web server" {
+		t.Errorf("member[0].Comment = %q, want %q", m0.Comment, "web server")
+	}
+
+	m1 := info.Members[1]
+	if m1.Timeout != nil || m1.Packets != nil || m1.Bytes != nil || m1.Comment != "" {
+		t.Errorf("member[1] should have no optional fields set, got %+v", m1)
+	}
+}
+
+func TestXMLMemberToMemberSKBFields(t *testing.T) {
+	xm := xmlMember{
+		Elem:     "10.0.0.1",
+		SKBMark:  "0x1234/0xffffffff",
+		SKBPrio:  "1:a",
+		SKBQueue: "3",
+	}
+
+	m, err := xm.toMember()
+	if err != nil {
+		t.Fatalf("toMember: %s", err)
+	}
+
+	if m.SKBMark == nil || *m.SKBMark != 0x1234 {
+		t.Errorf("SKBMark = %v, want 0x1234 (mask discarded)", m.SKBMark)
+	}
+	if m.SKBPrio == nil || *m.SKBPrio != (uint32(1)<<16|0xa) {
+		t.Errorf("SKBPrio = %v, want %#x", m.SKBPrio, uint32(1)<<16|0xa)
+	}
+	if m.SKBQueue == nil || *m.SKBQueue != 3 {
+		t.Errorf("SKBQueue = %v, want 3", m.SKBQueue)
+	}
+}
+
+func TestXMLMemberToMemberInvalidFields(t *testing.T) {
+	cases := []xmlMember{
+		{Elem: "e", Timeout: "not-a-number"},
+		{Elem: "e", Packets: "not-a-number"},
+		{Elem: "e", Bytes: "not-a-number"},
+		{Elem: "e", SKBMark: "not-hex"},
+		{Elem: "e", SKBPrio: "not-hex"},
+		{Elem: "e", SKBQueue: "not-a-number"},
+	}
+	for _, xm := range cases {
+		if _, err := xm.toMember(); err == nil {
+			t.Errorf("toMember(%+v) = nil error, want error", xm)
+		}
+	}
+}
+
+func TestAtoiOrZero(t *testing.T) {
+	if v, err := atoiOrZero(""); err != nil || v != 0 {
+		t.Fatalf("atoiOrZero(\"\") = %d, %v, want 0, nil", v, err)
+	}
+	if v, err := atoiOrZero("42"); err != nil || v != 42 {
+		t.Fatalf("atoiOrZero(\"42\") = %d, %v, want 42, nil", v, err)
+	}
+	if _, err := atoiOrZero("not-a-number"); err == nil {
+		t.Error("atoiOrZero(\"not-a-number\") = nil error, want error")
+	}
+}
@@ -0,0 +1,200 @@
+package ipset
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+)
+
+// These pin the numeric attribute IDs against linux/netfilter/ipset/ip_set.h
+// so a future edit can't silently reintroduce a collision between two
+// differently-named attributes.
+func TestNetlinkAttrConstants(t *testing.T) {
+	cases := map[string]struct {
+		got  uint16
+		want uint16
+	}{
+		"IP":       {ipsetAttrIP, 1},
+		"IPTo":     {ipsetAttrIPTo, 2},
+		"CIDR":     {ipsetAttrCIDR, 3},
+		"Port":     {ipsetAttrPort, 4},
+		"Timeout":  {ipsetAttrTimeout, 6},
+		"Proto":    {ipsetAttrProto, 7},
+		"HashSize": {ipsetAttrHashSize, 18},
+		"MaxElem":  {ipsetAttrMaxElem, 19},
+		"Ether":    {ipsetAttrEther, 17},
+	}
+	seen := map[uint16]string{}
+	for name, c := range cases {
+		if c.got != c.want {
+			t.Errorf("ipsetAttr%s = %d, want %d", name, c.got, c.want)
+		}
+	}
+	for name, c := range cases {
+		if other, ok := seen[c.got]; ok {
+			t.Errorf("ipsetAttr%s and ipsetAttr%s collide on value %d", name, other, c.got)
+		}
+		seen[c.got] = name
+	}
+}
+
+// Command-level attributes (sent alongside, not nested inside, IPSET_ATTR_DATA)
+// live in a separate namespace from the CADT attributes above, so they are
+// checked for their own values only, not cross-checked for collisions with them.
+func TestNetlinkCommandAttrConstants(t *testing.T) {
+	cases := map[string]struct {
+		got  uint16
+		want uint16
+	}{
+		"Protocol": {ipsetAttrProtocol, 1},
+		"SetName":  {ipsetAttrSetName, 2},
+		"TypeName": {ipsetAttrTypeName, 3},
+		"Revision": {ipsetAttrRevision, 4},
+		"Family":   {ipsetAttrFamily, 5},
+		"Data":     {ipsetAttrData, 7},
+		"ADT":      {ipsetAttrADT, 8},
+	}
+	for name, c := range cases {
+		if c.got != c.want {
+			t.Errorf("ipsetAttr%s = %d, want %d", name, c.got, c.want)
+		}
+	}
+}
+
+func TestIpsetErrExist(t *testing.T) {
+	if ipsetErrExist != 4103 {
+		t.Errorf("ipsetErrExist = %d, want 4103 (IPSET_ERR_PRIVATE=4096 + 7)", ipsetErrExist)
+	}
+}
+
+func TestHashTypeRevisionsKnownForHashTypes(t *testing.T) {
+	for hashType := range hashTypeRevisions {
+		if !strings.HasPrefix(hashType, "hash:") {
+			t.Errorf("hashTypeRevisions has non-hash type %q", hashType)
+		}
+	}
+}
+
+func TestAttrBuilderPut(t *testing.T) {
+	b := (&attrBuilder{}).put(5, []byte{0xaa})
+	got := b.bytes()
+	if len(got) != 8 {
+		t.Fatalf("expected padding to a 4-byte boundary, got %d bytes: %x", len(got), got)
+	}
+	if l := binary.LittleEndian.Uint16(got[0:2]); l != 5 {
+		t.Errorf("attr length = %d, want 5", l)
+	}
+	if typ := binary.LittleEndian.Uint16(got[2:4]); typ != 5 {
+		t.Errorf("attr type = %d, want 5", typ)
+	}
+	if got[4] != 0xaa {
+		t.Errorf("attr payload = %x, want aa", got[4])
+	}
+}
+
+func TestAttrBuilderPutUint32NetByteOrder(t *testing.T) {
+	b := (&attrBuilder{}).putUint32(ipsetAttrHashSize, 1024)
+	got := b.bytes()
+	typ := binary.LittleEndian.Uint16(got[2:4])
+	if typ&nlaFNetByteOrder == 0 {
+		t.Fatalf("expected NLA_F_NET_BYTEORDER flag set, type = %#x", typ)
+	}
+	if typ&0x3fff != ipsetAttrHashSize {
+		t.Errorf("attr type = %#x, want %d", typ&0x3fff, ipsetAttrHashSize)
+	}
+	if v := binary.BigEndian.Uint32(got[4:8]); v != 1024 {
+		t.Errorf("payload = %d, want 1024 (big-endian)", v)
+	}
+}
+
+func TestAttrBuilderPutNested(t *testing.T) {
+	inner := (&attrBuilder{}).put(ipsetAttrIPAddrIPv4, net.ParseIP("10.0.0.1").To4())
+	outer := (&attrBuilder{}).putNested(ipsetAttrIP, inner)
+	got := outer.bytes()
+	typ := binary.LittleEndian.Uint16(got[2:4])
+	if typ&nlaFNested == 0 {
+		t.Fatalf("expected NLA_F_NESTED flag set, type = %#x", typ)
+	}
+	if typ&0x3fff != ipsetAttrIP {
+		t.Errorf("attr type = %#x, want %d", typ&0x3fff, ipsetAttrIP)
+	}
+}
+
+func TestEncodeElement(t *testing.T) {
+	cases := []struct {
+		name  string
+		entry string
+	}{
+		{"bare ip", "10.0.0.1"},
+		{"ip with cidr", "10.0.0.0/24"},
+		{"ip with proto:port", "10.0.0.1,tcp:80"},
+		{"ip with mac", "10.0.0.1,aa:bb:cc:dd:ee:ff"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := encodeElement(c.entry); err != nil {
+				t.Fatalf("encodeElement(%q) = %v, want no error", c.entry, err)
+			}
+		})
+	}
+}
+
+func TestEncodeElementErrors(t *testing.T) {
+	cases := []string{
+		"not-an-ip",
+		"10.0.0.1/not-a-cidr",
+		"10.0.0.1,udp:not-a-port",
+		"10.0.0.1,bogus-proto:80",
+		"10.0.0.1,garbage",
+	}
+	for _, entry := range cases {
+		if _, err := encodeElement(entry); err == nil {
+			t.Errorf("encodeElement(%q) = nil error, want error", entry)
+		}
+	}
+}
+
+func TestIPProtoNumber(t *testing.T) {
+	cases := map[string]uint8{"tcp": 6, "udp": 17, "icmp": 1, "TCP": 6}
+	for proto, want := range cases {
+		got, err := ipProtoNumber(proto)
+		if err != nil {
+			t.Fatalf("ipProtoNumber(%q) error: %s", proto, err)
+		}
+		if got != want {
+			t.Errorf("ipProtoNumber(%q) = %d, want %d", proto, got, want)
+		}
+	}
+	if _, err := ipProtoNumber("sctp"); err == nil {
+		t.Error("ipProtoNumber(\"sctp\") = nil error, want error")
+	}
+}
+
+func TestParseTimeoutOpt(t *testing.T) {
+	if timeout, err := parseTimeoutOpt(nil); err != nil || timeout != nil {
+		t.Fatalf("parseTimeoutOpt(nil) = %v, %v, want nil, nil", timeout, err)
+	}
+	timeout, err := parseTimeoutOpt([]string{"timeout", "10"})
+	if err != nil {
+		t.Fatalf("parseTimeoutOpt error: %s", err)
+	}
+	if timeout == nil || *timeout != 10 {
+		t.Fatalf("parseTimeoutOpt timeout = %v, want 10", timeout)
+	}
+	if _, err := parseTimeoutOpt([]string{"timeout", "not-a-number"}); err == nil {
+		t.Error("parseTimeoutOpt with bad value = nil error, want error")
+	}
+	if _, err := parseTimeoutOpt([]string{"nomatch"}); err == nil {
+		t.Error("parseTimeoutOpt with unsupported option = nil error, want error")
+	}
+}
+
+func TestRejectOpts(t *testing.T) {
+	if err := rejectOpts(nil); err != nil {
+		t.Errorf("rejectOpts(nil) = %v, want nil", err)
+	}
+	if err := rejectOpts([]string{"comment", "x"}); err == nil {
+		t.Error("rejectOpts with options = nil error, want error")
+	}
+}